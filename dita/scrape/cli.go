@@ -0,0 +1,215 @@
+// CLI flags: input source, output format/quality/template, and
+// concurrency. Mirrors the ydl CLI's `-format mp3` UX, but goutubedl has no
+// postprocessor hooks of its own - it only gets us the best raw audio
+// stream via DownloadAudioOnly - so the actual mp3/m4a/opus conversion is
+// done by shelling out to ffmpeg, see transcode_audio in ffmpeg.go.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/wader/goutubedl"
+)
+
+// Config holds the flags and positional args for one run.
+type Config struct {
+	Input          string // newsboat|file|stdin|youtube-channel
+	Format         string // mp3|m4a|opus|best
+	Quality        string // yt-dlp --audio-quality, e.g. "0" or "192K"
+	OutputDir      string // root that OutputTemplate is resolved under
+	OutputTemplate string // yt-dlp style, e.g. %(uploader)s/%(title)s.%(ext)s
+	Concurrency    int
+	PlaylistIndex  int // yt-dlp calls this --playlist-items; we only support a single 1-indexed item
+	URLs           []string
+
+	// pipeline stage 1/2 knobs: resolving metadata is cheap (yt-dlp
+	// --dump-json) so it can run with far more parallelism than the
+	// actual downloads in stage 3
+	MetadataConcurrency int
+	MinDuration         float64 // seconds, 0 = no lower bound
+	MaxDuration         float64 // seconds, 0 = no upper bound
+	UploaderRE          *regexp.Regexp
+	TitleRE             *regexp.Regexp
+
+	// per-url min/max_duration overrides from --input youtube-channel
+	// configs, see poll_channels in feed.go. Checked ahead of
+	// MinDuration/MaxDuration above in passes_filters.
+	ChannelDurationOverrides map[string]ChannelConfig
+
+	// stage 3 segmented download knobs, see segment.go
+	Segments             int
+	MinSizeForSegmenting int64 // bytes
+
+	List        bool
+	Failed      bool
+	RetryFailed bool
+}
+
+func parse_cli() Config {
+	input := flag.String("input", "newsboat", "where to read urls from: newsboat|file|stdin|youtube-channel")
+	format := flag.String("format", "mp3", "output format: mp3|m4a|opus|best")
+	quality := flag.String("quality", "", "yt-dlp --audio-quality value, e.g. 0-9 or 192K")
+	outputDir := flag.String("output-dir", ".", "directory --output-template is resolved under")
+	outputTemplate := flag.String("output-template", "%(uploader)s/%(title)s.%(ext)s", "yt-dlp style output filename template")
+	concurrency := flag.Int("concurrency", 3, "number of concurrent download workers")
+	playlistItems := flag.Int("playlist-items", 1, "1-indexed playlist item to download")
+	metadataConcurrency := flag.Int("metadata-concurrency", 10, "number of concurrent metadata-resolve workers (cheap, can run higher than --concurrency)")
+	minDuration := flag.Float64("min-duration", 0, "skip videos shorter than this many seconds")
+	maxDuration := flag.Float64("max-duration", 0, "skip videos longer than this many seconds (0 = no limit)")
+	uploaderFilter := flag.String("uploader-filter", "", "only download videos whose uploader matches this regex")
+	titleFilter := flag.String("title-filter", "", "only download videos whose title matches this regex")
+	segments := flag.Int("segments", 4, "number of concurrent byte-range segments for large, range-capable downloads")
+	minSizeForSegmentingMB := flag.Int64("min-size-for-segmenting", default_min_size_for_segmenting/(1<<20), "minimum file size in MB before segmented download kicks in")
+	list := flag.Bool("list", false, "list everything in the download ledger and exit")
+	failed := flag.Bool("failed", false, "list only failed ledger entries and exit")
+	retryFailed := flag.Bool("retry-failed", false, "requeue failed ledger entries for download")
+	flag.Parse()
+
+	cfg := Config{
+		Input:                *input,
+		Format:               *format,
+		Quality:              *quality,
+		OutputDir:            *outputDir,
+		OutputTemplate:       *outputTemplate,
+		Concurrency:          *concurrency,
+		PlaylistIndex:        *playlistItems,
+		URLs:                 flag.Args(),
+		MetadataConcurrency:  *metadataConcurrency,
+		MinDuration:          *minDuration,
+		MaxDuration:          *maxDuration,
+		Segments:             *segments,
+		MinSizeForSegmenting: *minSizeForSegmentingMB * (1 << 20),
+		List:                 *list,
+		Failed:               *failed,
+		RetryFailed:          *retryFailed,
+	}
+
+	if *uploaderFilter != "" {
+		re, err := regexp.Compile(*uploaderFilter)
+		if err != nil {
+			log.Fatal("bad --uploader-filter: ", err)
+		}
+		cfg.UploaderRE = re
+	}
+	if *titleFilter != "" {
+		re, err := regexp.Compile(*titleFilter)
+		if err != nil {
+			log.Fatal("bad --title-filter: ", err)
+		}
+		cfg.TitleRE = re
+	}
+
+	return cfg
+}
+
+func read_lines_from(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	return scan_lines(file)
+}
+
+func read_stdin() []string {
+	return scan_lines(os.Stdin)
+}
+
+func scan_lines(f *os.File) []string {
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return urls
+}
+
+// resolve_urls dispatches on cfg.Input. main only calls it when no
+// positional urls were given, or with --input file, where the first
+// positional arg is the path to read urls from, e.g.
+// `dita --input file urls.txt`. cfg is a
+// pointer so the youtube-channel case can thread per-channel duration
+// overrides (see poll_channels) through to the caller's later
+// run_pipeline call.
+func resolve_urls(db *sql.DB, cfg *Config) []string {
+	switch cfg.Input {
+	case "newsboat":
+		return read_lines()
+	case "file":
+		if len(cfg.URLs) == 0 {
+			log.Fatal("--input file requires a path as the positional argument")
+		}
+		return read_lines_from(cfg.URLs[0])
+	case "stdin":
+		return read_stdin()
+	case "youtube-channel":
+		channels, err := load_channels()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(channels) == 0 {
+			log.Fatal("--input youtube-channel: no channels configured in ", channels_config_path())
+		}
+		toDownload, metadataOnly, durationOverrides := poll_channels(db, channels)
+		cfg.ChannelDurationOverrides = durationOverrides
+		if len(metadataOnly) > 0 {
+			// still worth resolving so the ledger has their metadata,
+			// just don't hand them to the download scheduler
+			for range resolve_stage(db, *cfg, metadataOnly) {
+			}
+		}
+		return toDownload
+	default:
+		log.Fatal("unknown --input: ", cfg.Input)
+		return nil
+	}
+}
+
+// render_template expands a yt-dlp style %(field)s output template using
+// metadata goutubedl already fetched for us.
+func render_template(tmpl string, info goutubedl.Info, ext string) string {
+	r := strings.NewReplacer(
+		"%(uploader)s", sanitize_path_component(info.Uploader),
+		"%(title)s", sanitize_path_component(info.Title),
+		"%(ext)s", ext,
+	)
+	return r.Replace(tmpl)
+}
+
+// sanitize_path_component strips path separators out of metadata fields
+// before they end up as part of a filename.
+func sanitize_path_component(s string) string {
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(s)
+}
+
+// download_options builds the goutubedl options for the configured format.
+// goutubedl has no audio-format/quality postprocessor fields, only
+// DownloadAudioOnly - actual transcoding to cfg.Format/cfg.Quality happens
+// afterwards via transcode_audio.
+func download_options(cfg Config) goutubedl.DownloadOptions {
+	return goutubedl.DownloadOptions{
+		PlaylistIndex:     cfg.PlaylistIndex, // 1-indexed!
+		DownloadAudioOnly: cfg.Format != "best",
+	}
+}
+
+func ext_for(cfg Config) string {
+	if cfg.Format == "best" {
+		return "mp4"
+	}
+	return cfg.Format
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/wader/goutubedl"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	info := goutubedl.Info{Uploader: "Some Uploader", Title: "A Title"}
+	got := render_template("%(uploader)s/%(title)s.%(ext)s", info, "mp3")
+	want := "Some Uploader/A Title.mp3"
+	if got != want {
+		t.Fatalf("render_template() = %q, want %q", got, want)
+	}
+}
+
+func TestSanitizePathComponentStripsSeparators(t *testing.T) {
+	got := sanitize_path_component("a/b\\c")
+	want := "a-b-c"
+	if got != want {
+		t.Fatalf("sanitize_path_component() = %q, want %q", got, want)
+	}
+}
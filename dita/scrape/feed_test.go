@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const sampleFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns="http://www.w3.org/2005/Atom">
+	<entry>
+		<yt:videoId>dQw4w9WgXcQ</yt:videoId>
+		<title>Some Video Title</title>
+	</entry>
+	<entry>
+		<yt:videoId>abc123</yt:videoId>
+		<title>Another Title</title>
+	</entry>
+</feed>`
+
+func TestAtomFeedUnmarshal(t *testing.T) {
+	var feed atomFeed
+	if err := xml.Unmarshal([]byte(sampleFeed), &feed); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(feed.Entries))
+	}
+	if feed.Entries[0].VideoID != "dQw4w9WgXcQ" || feed.Entries[0].Title != "Some Video Title" {
+		t.Fatalf("first entry = %+v, want videoId=dQw4w9WgXcQ title=%q", feed.Entries[0], "Some Video Title")
+	}
+}
+
+func TestChannelIDRegexMatchesEmbeddedMetadata(t *testing.T) {
+	page := []byte(`<script>var ytInitialData = {"channelId":"UCuAXFkgsw1L7xaCfnd5JJOw","foo":1};</script>`)
+	m := channelIDRe.FindSubmatch(page)
+	if m == nil {
+		t.Fatal("channelIDRe did not match")
+	}
+	if string(m[1]) != "UCuAXFkgsw1L7xaCfnd5JJOw" {
+		t.Fatalf("got channel id %q, want UCuAXFkgsw1L7xaCfnd5JJOw", m[1])
+	}
+}
+
+func TestPassesChannelTitleFilter(t *testing.T) {
+	ch := ChannelConfig{TitleRegex: "^Official"}
+	if !passes_channel_title_filter(ch, atomEntry{Title: "Official Trailer"}) {
+		t.Fatal("expected matching title to pass")
+	}
+	if passes_channel_title_filter(ch, atomEntry{Title: "Fan Edit"}) {
+		t.Fatal("expected non-matching title to be filtered out")
+	}
+}
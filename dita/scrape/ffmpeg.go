@@ -0,0 +1,40 @@
+// goutubedl streams whatever yt-dlp hands it back and exposes no
+// postprocessor/audio-extraction knobs beyond DownloadAudioOnly, so
+// actually producing mp3/m4a/opus at a given quality means shelling out to
+// ffmpeg ourselves, same as yt-dlp's own --extract-audio does internally.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+// vbrQualityRE matches yt-dlp's --audio-quality VBR scale: a single digit
+// 0 (best) through 9 (worst). Anything else (e.g. "192K") is a bitrate.
+var vbrQualityRE = regexp.MustCompile(`^[0-9]$`)
+
+// transcode_audio converts src (whatever raw audio goutubedl downloaded)
+// into dst at the given format/quality. src is left in place; callers remove
+// it once this succeeds. quality
+// follows yt-dlp's --audio-quality convention: either a 0-9 VBR level
+// (mapped to ffmpeg's -q:a) or a bitrate string like "192K" (-b:a) -
+// "0" fed straight to -b:a would be an invalid (zero) bitrate.
+func transcode_audio(src, dst, quality string) error {
+	args := []string{"-y", "-i", src, "-vn"}
+	switch {
+	case quality == "":
+	case vbrQualityRE.MatchString(quality):
+		args = append(args, "-q:a", quality)
+	default:
+		args = append(args, "-b:a", quality)
+	}
+	args = append(args, dst)
+
+	out, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg %s -> %s: %w: %s", src, dst, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// SQLite-backed download ledger, so repeated runs don't have to trust
+// os.Stat(fname) alone to know what's already been grabbed.
+//
+// loosely mirrors the CSV manifest (videoID + unique-number) used by the
+// police-brutality downloader, but SQLite gives us safe concurrent writes
+// from the goroutine pool instead of one process owning the file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// log_ledger_err surfaces a write failure instead of silently dropping it -
+// a SQLITE_BUSY under worker-pool contention would otherwise vanish.
+func log_ledger_err(op string, err error) {
+	if err != nil {
+		fmt.Println("ledger:", op, "failed:", err)
+	}
+}
+
+const ledgerSchema = `
+CREATE TABLE IF NOT EXISTS downloads (
+	url         TEXT PRIMARY KEY,
+	video_id    TEXT,
+	title       TEXT,
+	uploader    TEXT,
+	duration    REAL, -- seconds, from goutubedl.Info.Duration
+	filepath    TEXT,
+	status      TEXT NOT NULL DEFAULT 'pending', -- pending|in_progress|done|failed
+	attempts    INTEGER NOT NULL DEFAULT 0,
+	last_error  TEXT,
+	http_code   INTEGER,
+	finished_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS feeds (
+	source     TEXT NOT NULL,
+	url        TEXT NOT NULL,
+	first_seen DATETIME NOT NULL,
+	PRIMARY KEY (source, url)
+);
+`
+
+// duration wasn't part of the original schema; add it for ledgers created
+// before this column existed. On a database that already has the column
+// this ALTER TABLE fails; that error is expected and ignored.
+const addDurationColumn = `ALTER TABLE downloads ADD COLUMN duration REAL`
+
+// Download is a row of the downloads table.
+type Download struct {
+	URL        string
+	VideoID    string
+	Title      string
+	Uploader   string
+	Duration   float64 // seconds
+	Filepath   string
+	Status     string
+	Attempts   int
+	LastError  string
+	HTTPCode   int
+	FinishedAt time.Time
+}
+
+func ledger_path() string {
+	usr, _ := user.Current()
+	dir := usr.HomeDir + "/.local/share/dita"
+	os.MkdirAll(dir, 0750)
+	return filepath.Join(dir, "dita.db")
+}
+
+func open_ledger() (*sql.DB, error) {
+	// the download worker pool and the metadata resolve pool both hit
+	// this concurrently; _busy_timeout makes writers wait out a lock
+	// instead of failing immediately with SQLITE_BUSY, and WAL lets
+	// readers and a writer run at the same time. SetMaxOpenConns(1) on
+	// top of that serializes writers through a single *sql.DB connection
+	// so mattn/go-sqlite3 never hands two goroutines a connection each
+	// and has them race for the same lock.
+	db, err := sql.Open("sqlite3", ledger_path()+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(ledgerSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.Exec(addDurationColumn) // no-op on a fresh DB, which already has the column
+	return db, nil
+}
+
+// get_download returns nil, nil if url isn't in the ledger yet.
+func get_download(db *sql.DB, url string) (*Download, error) {
+	row := db.QueryRow(`SELECT url, video_id, title, uploader, coalesce(duration, 0), filepath, status, attempts, last_error, http_code FROM downloads WHERE url = ?`, url)
+	var d Download
+	var videoID, title, uploader, fname, lastErr sql.NullString
+	var httpCode sql.NullInt64
+	err := row.Scan(&d.URL, &videoID, &title, &uploader, &d.Duration, &fname, &d.Status, &d.Attempts, &lastErr, &httpCode)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.VideoID, d.Title, d.Uploader, d.Filepath, d.LastError = videoID.String, title.String, uploader.String, fname.String, lastErr.String
+	d.HTTPCode = int(httpCode.Int64)
+	return &d, nil
+}
+
+// upsert_metadata records what the cheap goutubedl.New resolve step learned
+// about a url, without touching status/attempts — so a later run can reuse
+// video_id/title/uploader/duration for filtering instead of resolving again.
+func upsert_metadata(db *sql.DB, url, videoID, title, uploader string, duration float64) error {
+	_, err := db.Exec(`
+		INSERT INTO downloads (url, video_id, title, uploader, duration, status) VALUES (?, ?, ?, ?, ?, 'pending')
+		ON CONFLICT(url) DO UPDATE SET video_id = excluded.video_id, title = excluded.title, uploader = excluded.uploader, duration = excluded.duration
+	`, url, videoID, title, uploader, duration)
+	return err
+}
+
+func mark_in_progress(db *sql.DB, url string) error {
+	_, err := db.Exec(`
+		INSERT INTO downloads (url, status, attempts) VALUES (?, 'in_progress', 1)
+		ON CONFLICT(url) DO UPDATE SET status = 'in_progress', attempts = attempts + 1
+	`, url)
+	return err
+}
+
+func mark_done(db *sql.DB, url string, d Download) error {
+	_, err := db.Exec(`
+		UPDATE downloads SET video_id = ?, title = ?, uploader = ?, filepath = ?, status = 'done', finished_at = ?
+		WHERE url = ?
+	`, d.VideoID, d.Title, d.Uploader, d.Filepath, time.Now(), url)
+	return err
+}
+
+// mark_failed upserts rather than updates: a url that fails during the
+// resolve stage (goutubedl.New itself, before any mark_in_progress or
+// upsert_metadata) was never inserted into the ledger, so a plain UPDATE
+// would silently affect zero rows and the failure would never show up in
+// --failed/--retry-failed.
+func mark_failed(db *sql.DB, url string, cause error, httpCode int) error {
+	_, err := db.Exec(`
+		INSERT INTO downloads (url, status, last_error, http_code) VALUES (?, 'failed', ?, ?)
+		ON CONFLICT(url) DO UPDATE SET status = 'failed', last_error = excluded.last_error, http_code = excluded.http_code
+	`, url, cause.Error(), httpCode)
+	return err
+}
+
+// feed_seen reports whether a (source, url) pair has already been recorded
+// by a previous feed poll, so we don't re-enqueue the same video forever.
+func feed_seen(db *sql.DB, source, url string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM feeds WHERE source = ? AND url = ?`, source, url).Scan(&n)
+	return n > 0, err
+}
+
+func mark_feed_seen(db *sql.DB, source, url string) error {
+	_, err := db.Exec(`INSERT OR IGNORE INTO feeds (source, url, first_seen) VALUES (?, ?, ?)`, source, url, time.Now())
+	return err
+}
+
+func list_downloads(db *sql.DB, status string) ([]Download, error) {
+	rows, err := db.Query(`SELECT url, coalesce(video_id, ''), coalesce(title, ''), coalesce(uploader, ''), coalesce(filepath, ''), status, attempts, coalesce(last_error, ''), coalesce(http_code, 0) FROM downloads WHERE status = ? ORDER BY url`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Download
+	for rows.Next() {
+		var d Download
+		if err := rows.Scan(&d.URL, &d.VideoID, &d.Title, &d.Uploader, &d.Filepath, &d.Status, &d.Attempts, &d.LastError, &d.HTTPCode); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
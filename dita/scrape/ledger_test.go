@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// open_test_ledger wires up the same schema open_ledger does, against an
+// in-memory DB - open_ledger itself always points at ledger_path() under
+// the real home directory, which isn't something a unit test should touch.
+func open_test_ledger(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := db.Exec(ledgerSchema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpsertMetadataThenGetDownload(t *testing.T) {
+	db := open_test_ledger(t)
+	url := "https://example.com/watch?v=abc"
+
+	if err := upsert_metadata(db, url, "abc", "a title", "an uploader", 123.5); err != nil {
+		t.Fatalf("upsert_metadata: %v", err)
+	}
+
+	d, err := get_download(db, url)
+	if err != nil {
+		t.Fatalf("get_download: %v", err)
+	}
+	if d == nil {
+		t.Fatal("get_download returned nil after upsert_metadata")
+	}
+	if d.VideoID != "abc" || d.Title != "a title" || d.Uploader != "an uploader" || d.Duration != 123.5 {
+		t.Fatalf("got %+v, want video_id=abc title=%q uploader=%q duration=123.5", d, "a title", "an uploader")
+	}
+	if d.Status != "pending" {
+		t.Fatalf("status = %q, want pending", d.Status)
+	}
+}
+
+func TestMarkFailedWithoutPriorInsert(t *testing.T) {
+	db := open_test_ledger(t)
+	url := "https://example.com/watch?v=never-resolved"
+
+	if err := mark_failed(db, url, errResolveFailed, 0); err != nil {
+		t.Fatalf("mark_failed on a url never inserted: %v", err)
+	}
+
+	failed, err := list_downloads(db, "failed")
+	if err != nil {
+		t.Fatalf("list_downloads: %v", err)
+	}
+	if len(failed) != 1 || failed[0].URL != url {
+		t.Fatalf("got %+v, want a single failed row for %q", failed, url)
+	}
+}
+
+var errResolveFailed = sql.ErrNoRows // stand-in error value, only its .Error() string is used
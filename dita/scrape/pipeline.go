@@ -0,0 +1,132 @@
+// splits the old monolithic download() into a staged pipeline, similar to
+// yogai's fetch/process split:
+//
+//	stage 1 (resolve): goutubedl.New per url - cheap, yt-dlp --dump-json
+//	stage 2 (filter):  duration/uploader/title regex, already-downloaded
+//	stage 3 (download): the scheduler from scheduler.go
+//
+// stage 1 runs at cfg.MetadataConcurrency, which can be much higher than
+// cfg.Concurrency since resolving metadata doesn't trigger 429s the way
+// actual downloads do. resolved metadata is written to the ledger so a
+// later run can skip stage 1 entirely for urls it has already seen.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/wader/goutubedl"
+)
+
+type videoMeta struct {
+	URL  string
+	Info goutubedl.Info
+}
+
+// resolve_stage fans out url resolution over cfg.MetadataConcurrency
+// workers and returns the results on a channel, closed once every url has
+// been resolved (or skipped/failed).
+func resolve_stage(db *sql.DB, cfg Config, urls []string) <-chan videoMeta {
+	in := make(chan string, len(urls))
+	out := make(chan videoMeta, len(urls))
+	for _, u := range urls {
+		in <- u
+	}
+	close(in)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.MetadataConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range in {
+				resolve_one(db, cfg, url, out)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+func resolve_one(db *sql.DB, cfg Config, url string, out chan<- videoMeta) {
+	if existing, err := get_download(db, url); err == nil && existing != nil {
+		if existing.Status == "done" {
+			return // already have it, nothing to resolve or download
+		}
+		// skip the network resolve entirely, reuse what's already in the
+		// ledger - but only once duration is actually persisted for this
+		// row; a zero duration on a filtered run would otherwise mean
+		// every cached row gets dropped by a --min-duration filter
+		haveDuration := existing.Duration > 0 || (cfg.MinDuration == 0 && cfg.MaxDuration == 0)
+		if existing.VideoID != "" && haveDuration {
+			out <- videoMeta{URL: url, Info: goutubedl.Info{
+				ID:       existing.VideoID,
+				Title:    existing.Title,
+				Uploader: existing.Uploader,
+				Duration: existing.Duration,
+			}}
+			return
+		}
+	}
+
+	gdl, err := goutubedl.New(context.Background(), url, goutubedl.Options{})
+	if err != nil {
+		fmt.Println("could not resolve", url)
+		log_ledger_err("mark_failed", mark_failed(db, url, err, 0))
+		return
+	}
+	log_ledger_err("upsert_metadata", upsert_metadata(db, url, gdl.Info.ID, gdl.Info.Title, gdl.Info.Uploader, gdl.Info.Duration))
+	out <- videoMeta{URL: url, Info: gdl.Info}
+}
+
+// filter_stage drops videos that don't match the configured duration/regex
+// filters, logging what it drops rather than silently discarding it.
+func filter_stage(cfg Config, in <-chan videoMeta) []string {
+	var urls []string
+	for m := range in {
+		if !passes_filters(cfg, m.URL, m.Info) {
+			fmt.Println("filtered out", m.URL, m.Info.Title)
+			continue
+		}
+		urls = append(urls, m.URL)
+	}
+	return urls
+}
+
+func passes_filters(cfg Config, url string, info goutubedl.Info) bool {
+	minDuration, maxDuration := cfg.MinDuration, cfg.MaxDuration
+	if ch, ok := cfg.ChannelDurationOverrides[url]; ok {
+		if ch.MinDuration > 0 {
+			minDuration = ch.MinDuration
+		}
+		if ch.MaxDuration > 0 {
+			maxDuration = ch.MaxDuration
+		}
+	}
+	if minDuration > 0 && info.Duration < minDuration {
+		return false
+	}
+	if maxDuration > 0 && info.Duration > maxDuration {
+		return false
+	}
+	if cfg.UploaderRE != nil && !cfg.UploaderRE.MatchString(info.Uploader) {
+		return false
+	}
+	if cfg.TitleRE != nil && !cfg.TitleRE.MatchString(info.Title) {
+		return false
+	}
+	return true
+}
+
+// run_pipeline resolves metadata and filters urls, returning the subset
+// that's actually worth handing to the download scheduler.
+func run_pipeline(db *sql.DB, cfg Config, urls []string) []string {
+	resolved := resolve_stage(db, cfg, urls)
+	return filter_stage(cfg, resolved)
+}
@@ -0,0 +1,199 @@
+// worker pool + per-host token bucket, replacing the old fixed n_chunks=3
+// workaround. yt-dlp's "HTTP Error 429" is detected from the error string
+// goutubedl hands back; on a 429 the url is requeued with exponential
+// backoff + jitter and the offending host's rate limiter is narrowed. The
+// narrowing is only temporary: a string of clean downloads widens it back up.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	max_attempts = 5
+	base_backoff = 30 * time.Second
+	max_backoff  = 30 * time.Minute
+	default_rps  = 1.0 // requests/sec per host before any 429 narrows it
+	min_host_rps = 0.05
+
+	// successes a host needs in a row, after being narrowed, before its
+	// limit is widened back up a step - so recovery doesn't happen on the
+	// first lucky request right after a burst of 429s
+	widen_after_successes = 5
+)
+
+type scheduler struct {
+	db  *sql.DB
+	cfg Config
+
+	mu        sync.Mutex
+	limiters  map[string]*rate.Limiter
+	successes map[string]int // consecutive non-429s since the host was last narrowed
+}
+
+func new_scheduler(db *sql.DB, cfg Config) *scheduler {
+	return &scheduler{
+		db:        db,
+		cfg:       cfg,
+		limiters:  make(map[string]*rate.Limiter),
+		successes: make(map[string]int),
+	}
+}
+
+func host_of(url string) string {
+	splits := strings.Split(url, "/")
+	if len(splits) > 2 {
+		return splits[2]
+	}
+	return url
+}
+
+func (s *scheduler) limiter_for_host(host string) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[host]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(default_rps), 1)
+		s.limiters[host] = l
+	}
+	return l
+}
+
+// narrow_host halves a host's rate limit after a 429, down to a floor.
+func (s *scheduler) narrow_host(host string) {
+	l := s.limiter_for_host(host)
+	newLimit := l.Limit() / 2
+	if newLimit < rate.Limit(min_host_rps) {
+		newLimit = rate.Limit(min_host_rps)
+	}
+	l.SetLimit(newLimit)
+
+	s.mu.Lock()
+	s.successes[host] = 0
+	s.mu.Unlock()
+
+	fmt.Println("429 from", host, "- rate limit narrowed to", newLimit, "req/s")
+}
+
+// note_success records a clean download and, once a host has strung together
+// widen_after_successes of them in a row, doubles its rate limit back up
+// toward default_rps. "narrowed" is only ever temporary this way; a host that
+// recovers from a burst of 429s isn't stuck throttled at the floor forever.
+func (s *scheduler) note_success(host string) {
+	l := s.limiter_for_host(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l.Limit() >= rate.Limit(default_rps) {
+		s.successes[host] = 0
+		return
+	}
+
+	s.successes[host]++
+	if s.successes[host] < widen_after_successes {
+		return
+	}
+	s.successes[host] = 0
+
+	newLimit := l.Limit() * 2
+	if newLimit > rate.Limit(default_rps) {
+		newLimit = rate.Limit(default_rps)
+	}
+	l.SetLimit(newLimit)
+	fmt.Println(host, "recovered -", widen_after_successes, "downloads in a row, rate limit widened to", newLimit, "req/s")
+}
+
+func is_rate_limited(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "HTTP Error 429")
+}
+
+// backoff_duration is 30s, 60s, 120s, ... capped at max_backoff, plus jitter
+// so a batch of requeued urls doesn't all wake up at the same instant.
+func backoff_duration(attempt int) time.Duration {
+	d := time.Duration(float64(base_backoff) * math.Pow(2, float64(attempt-1)))
+	if d > max_backoff {
+		d = max_backoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/4 + 1))
+	return d + jitter
+}
+
+type job struct {
+	url     string
+	attempt int
+}
+
+// run downloads every url, retrying failed ones with backoff (a 429 also
+// narrows the host's rate limit), and
+// blocks until all jobs (including retries) have settled.
+func (s *scheduler) run(urls []string) {
+	jobs := make(chan job, len(urls)*2)
+	var wg sync.WaitGroup
+
+	for _, url := range urls {
+		wg.Add(1)
+		jobs <- job{url: url, attempt: 1}
+	}
+
+	// closed once wg hits zero, i.e. once nothing is queued or in flight
+	go func() {
+		wg.Wait()
+		close(jobs)
+	}()
+
+	var workerWg sync.WaitGroup
+	for i := 0; i < s.cfg.Concurrency; i++ {
+		workerWg.Add(1)
+		go func() {
+			defer workerWg.Done()
+			for j := range jobs {
+				s.process(j, jobs, &wg)
+			}
+		}()
+	}
+	workerWg.Wait()
+}
+
+func (s *scheduler) process(j job, jobs chan job, wg *sync.WaitGroup) {
+	host := host_of(j.url)
+	s.limiter_for_host(host).Wait(context.Background())
+
+	_, err := download(s.db, j.url, s.cfg)
+	if err == nil {
+		s.note_success(host)
+		wg.Done()
+		return
+	}
+
+	if is_rate_limited(err) {
+		s.narrow_host(host)
+	}
+
+	if j.attempt >= max_attempts {
+		fmt.Println("giving up on", j.url, "after", j.attempt, "attempts")
+		wg.Done()
+		return
+	}
+
+	wait := backoff_duration(j.attempt)
+	fmt.Println("retrying", j.url, "in", wait, "(attempt", j.attempt+1, "of", max_attempts, ")")
+	// register the retry's wg slot before releasing this one, so the
+	// "all done" watcher never observes a transient count of zero
+	wg.Add(1)
+	wg.Done()
+	go func() {
+		time.Sleep(wait)
+		jobs <- job{url: j.url, attempt: j.attempt + 1}
+	}()
+}
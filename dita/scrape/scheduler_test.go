@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestBackoffDurationIncreasesAndCaps(t *testing.T) {
+	prev := backoff_duration(1)
+	for attempt := 2; attempt <= 10; attempt++ {
+		d := backoff_duration(attempt)
+		// once capped, jitter alone varies the result, so compare against
+		// the cap rather than the previous (jittered) value
+		floor := prev
+		if floor > max_backoff {
+			floor = max_backoff
+		}
+		if d < floor {
+			t.Fatalf("backoff_duration(%d) = %v, want >= min(backoff_duration(%d), max_backoff) = %v", attempt, d, attempt-1, floor)
+		}
+		if d > max_backoff+max_backoff/4 {
+			t.Fatalf("backoff_duration(%d) = %v, want <= max_backoff (%v) plus jitter", attempt, d, max_backoff)
+		}
+		prev = d
+	}
+}
+
+func TestBackoffDurationAtLeastBase(t *testing.T) {
+	if d := backoff_duration(1); d < base_backoff {
+		t.Fatalf("backoff_duration(1) = %v, want >= base_backoff (%v)", d, base_backoff)
+	}
+}
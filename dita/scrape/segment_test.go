@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSplitRangesCoversWholeFileWithNoGaps(t *testing.T) {
+	size := int64(1000)
+	ranges := split_ranges(size, 4)
+	if len(ranges) != 4 {
+		t.Fatalf("got %d ranges, want 4", len(ranges))
+	}
+	if ranges[0].start != 0 {
+		t.Fatalf("first range starts at %d, want 0", ranges[0].start)
+	}
+	if ranges[len(ranges)-1].end != size-1 {
+		t.Fatalf("last range ends at %d, want %d", ranges[len(ranges)-1].end, size-1)
+	}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].start != ranges[i-1].end+1 {
+			t.Fatalf("gap/overlap between range %d (end=%d) and range %d (start=%d)", i-1, ranges[i-1].end, i, ranges[i].start)
+		}
+	}
+}
+
+func TestSplitRangesGuardsZeroSegments(t *testing.T) {
+	ranges := split_ranges(100, 0)
+	if len(ranges) != 1 {
+		t.Fatalf("split_ranges(100, 0) returned %d ranges, want 1 (guarded to at least one segment)", len(ranges))
+	}
+	if ranges[0].start != 0 || ranges[0].end != 99 {
+		t.Fatalf("split_ranges(100, 0) = %+v, want the whole file in one range", ranges[0])
+	}
+}
@@ -5,38 +5,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"database/sql"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/user"
-	"strings"
+	"path/filepath"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/wader/goutubedl"
 )
 
-func array_split(slice []string, chunkSize int) [][]string {
-	// https://freshman.tech/snippets/go/split-slice-into-chunks/
-	var chunks [][]string
-	// not incrementing will lead to truncation (e.g. 10/3 -> 3 3 3)
-	chunkSize += 1
-	for {
-		if len(slice) == 0 {
-			break
-		}
-
-		if len(slice) < chunkSize {
-			chunkSize = len(slice)
-		}
-
-		chunks = append(chunks, slice[0:chunkSize])
-		slice = slice[chunkSize:]
-	}
-
-	return chunks
-}
-
 func read_lines() []string {
 	usr, _ := user.Current()
 	home := usr.HomeDir
@@ -60,75 +39,176 @@ func read_lines() []string {
 	return urls
 }
 
-func download(url string, channel chan string) { // {{{
+// download fetches a single url, updating the ledger as it goes. The
+// returned error is the raw error from goutubedl (possibly wrapping yt-dlp's
+// "HTTP Error 429") or from transcode_audio, so the scheduler can decide
+// whether to back off and retry.
+func download(db *sql.DB, url string, cfg Config) (string, error) { // {{{
 	// https://github.com/wader/goutubedl/blob/8b34407df2f32ea3710f99f404d2d1d6064bd82c/goutubedl_test.go#L442
 	// https://github.com/wader/goutubedl/blob/8b34407df2f32ea3710f99f404d2d1d6064bd82c/goutubedl_test.go#L64
 	// https://github.com/wader/goutubedl?tab=readme-ov-file#usage
 
-	splits := strings.Split(url, "/")
-	fname := strings.Split(splits[2], ".")[0] + "-" + splits[len(splits)-1] + ".mp3"
-	// TODO: cwd, not .
-	fname = "./testdir/" + fname
-
-	if _, err := os.Stat(fname); err == nil {
-		// fmt.Println("already exists", fname)
-		channel <- fname
-		return
+	if existing, err := get_download(db, url); err == nil && existing != nil && existing.Status == "done" {
+		if _, err := os.Stat(existing.Filepath); err == nil {
+			return existing.Filepath, nil
+		}
+		// ledger says done but the file is gone; fall through and re-fetch
 	}
 
+	log_ledger_err("mark_in_progress", mark_in_progress(db, url))
+
 	gdl, err := goutubedl.New(context.Background(), url, goutubedl.Options{})
 	if err != nil {
-		// TODO: handle 429
 		fmt.Println("could not fetch", url)
-		channel <- fname
-		return
-		// log.Fatal(err)
+		log_ledger_err("mark_failed", mark_failed(db, url, err, 0))
+		return "", err
 	}
 
-	// result, err := result.Download(context.Background(), "best")
+	fname := filepath.Join(cfg.OutputDir, render_template(cfg.OutputTemplate, gdl.Info, ext_for(cfg)))
+
 	fmt.Println("downloading", url)
 
-	result, err := gdl.DownloadWithOptions(
-		// TODO audio only
-		context.Background(),
-		goutubedl.DownloadOptions{PlaylistIndex: 1}, // 1-indexed!
-	)
+	if direct, ok := direct_url_for(url, cfg); ok {
+		if size, supportsRanges, err := head_range_info(direct); err == nil && supportsRanges && size >= cfg.MinSizeForSegmenting {
+			// same raw-name-then-transcode dance as the single-stream path
+			// below: goutubedl/yt-dlp hand us the raw stream either way, so
+			// a non-"best" format still needs ffmpeg to actually become
+			// mp3/m4a/opus rather than being written verbatim.
+			segRawName := fname
+			if cfg.Format != "best" {
+				segRawName = fname + ".raw"
+			}
+			err := segmented_download(direct, segRawName, size, cfg.Segments)
+			if err == nil && segRawName != fname {
+				err = transcode_audio(segRawName, fname, cfg.Quality)
+				if err == nil {
+					os.Remove(segRawName)
+				}
+			}
+			if err == nil {
+				log_ledger_err("mark_done", mark_done(db, url, Download{
+					VideoID:  gdl.Info.ID,
+					Title:    gdl.Info.Title,
+					Uploader: gdl.Info.Uploader,
+					Filepath: fname,
+				}))
+				return fname, nil
+			}
+			fmt.Println("segmented download of", url, "failed, falling back to single-stream:", err)
+			// the partial segRawName (and its .part resume state) are
+			// about to be superseded by a from-scratch single-stream
+			// fetch; leaving them around would make a future segmented
+			// retry trust stale "completed" indices against a file it
+			// never actually wrote
+			os.Remove(segRawName)
+			os.Remove(part_state_path(segRawName))
+		}
+	}
+
+	result, err := gdl.DownloadWithOptions(context.Background(), download_options(cfg))
 	if err != nil {
 		// log.Fatal(err)
 		fmt.Println("could not download", url)
-		channel <- fname
-		return
+		log_ledger_err("mark_failed", mark_failed(db, url, err, 0))
+		return "", err
 	}
 	defer result.Close()
-	os.Mkdir("./testdir", 0750)
+	os.MkdirAll(filepath.Dir(fname), 0750)
+
+	// goutubedl only gets us the raw audio stream; if the user asked for
+	// a specific format, write it out under a temp name and let ffmpeg
+	// do the actual mp3/m4a/opus conversion.
+	rawName := fname
+	if cfg.Format != "best" {
+		rawName = fname + ".raw"
+	}
 
-	file, err := os.Create(fname)
+	file, err := os.Create(rawName)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer file.Close()
 	io.Copy(file, result)
-	channel <- fname
+	file.Close()
+
+	if rawName != fname {
+		if err := transcode_audio(rawName, fname, cfg.Quality); err != nil {
+			fmt.Println("could not transcode", url, ":", err)
+			log_ledger_err("mark_failed", mark_failed(db, url, err, 0))
+			return "", err
+		}
+		os.Remove(rawName)
+	}
+
+	log_ledger_err("mark_done", mark_done(db, url, Download{
+		VideoID:  gdl.Info.ID,
+		Title:    gdl.Info.Title,
+		Uploader: gdl.Info.Uploader,
+		Filepath: fname,
+	}))
+	return fname, nil
 } // }}}
 
 // https://stackoverflow.com/a/41439170
 // https://koalatea.io/go-channels/
 // channels -> single array directly https://stackoverflow.com/a/36563718
 
+func print_downloads(ds []Download) {
+	for _, d := range ds {
+		fmt.Printf("%s\t%s\t%s\t(attempts=%d)\n", d.Status, d.URL, d.LastError, d.Attempts)
+	}
+}
+
 func main() {
-	urls := read_lines()
-	n_chunks := 3 // 4 chunks is very likely to 429
-	chunks := array_split(urls, len(urls)/n_chunks)
-	c := make(chan string)
-	for i := 0; i < n_chunks; i++ {
-		urls := chunks[i]
-		go func() {
-			for _, url := range urls {
-				download(url, c)
+	cfg := parse_cli()
+
+	db, err := open_ledger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if cfg.List {
+		var all []Download
+		for _, status := range []string{"pending", "in_progress", "done", "failed"} {
+			ds, err := list_downloads(db, status)
+			if err != nil {
+				log.Fatal(err)
 			}
-		}()
+			all = append(all, ds...)
+		}
+		print_downloads(all)
+		return
 	}
-	for i := 0; i < len(urls); i++ {
-		<-c
+	if cfg.Failed {
+		bad, err := list_downloads(db, "failed")
+		if err != nil {
+			log.Fatal(err)
+		}
+		print_downloads(bad)
+		return
 	}
+
+	var urls []string
+	if cfg.RetryFailed {
+		bad, err := list_downloads(db, "failed")
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range bad {
+			urls = append(urls, d.URL)
+		}
+	} else if len(cfg.URLs) > 0 && cfg.Input != "file" {
+		urls = cfg.URLs
+	} else {
+		urls = resolve_urls(db, &cfg)
+	}
+
+	if !cfg.RetryFailed {
+		// retry-failed urls already went through the pipeline once; no
+		// need to re-resolve/re-filter them
+		urls = run_pipeline(db, cfg, urls)
+	}
+
+	sched := new_scheduler(db, cfg)
+	sched.run(urls)
 }